@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	FormatZip     = "zip"
+	FormatTar     = "tar"
+	FormatTarGz   = "tar.gz"
+	TarFileMode   = 0644
+	DefaultFormat = FormatZip
+)
+
+// Archiver packs a set of downloaded files into an archive of a particular
+// format and knows the file extension and Content-Type that go with it.
+type Archiver interface {
+	Ext() string
+	ContentType() string
+	Write(w io.Writer, files []*File) error
+}
+
+// archivers maps a client-chosen format name to its Archiver implementation.
+var archivers = map[string]Archiver{
+	FormatZip:   zipArchiver{},
+	FormatTar:   tarArchiver{},
+	FormatTarGz: tarGzArchiver{},
+}
+
+// archiverFor returns the Archiver registered for format, falling back to
+// the default (zip) when format is empty or unrecognized.
+func archiverFor(format string) (Archiver, error) {
+	if format == "" {
+		format = DefaultFormat
+	}
+
+	archiver, ok := archivers[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	return archiver, nil
+}
+
+// zipArchiver writes a standard zip archive.
+type zipArchiver struct{}
+
+func (zipArchiver) Ext() string         { return ".zip" }
+func (zipArchiver) ContentType() string { return "application/zip" }
+
+func (zipArchiver) Write(w io.Writer, files []*File) error {
+	zipWriter := zip.NewWriter(w)
+	defer zipWriter.Close()
+
+	for _, file := range files {
+		name := filepath.Base(file.Filename)
+
+		fileWriter, err := zipWriter.Create(name)
+		if err != nil {
+			return fmt.Errorf("add %s to archive: %w", name, err)
+		}
+
+		if err := copyFileInto(fileWriter, file); err != nil {
+			return fmt.Errorf("write %s to archive: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// tarArchiver writes an uncompressed POSIX tar archive.
+type tarArchiver struct{}
+
+func (tarArchiver) Ext() string         { return ".tar" }
+func (tarArchiver) ContentType() string { return "application/x-tar" }
+
+func (tarArchiver) Write(w io.Writer, files []*File) error {
+	tarWriter := tar.NewWriter(w)
+	defer tarWriter.Close()
+
+	return writeFilesToTar(tarWriter, files)
+}
+
+// tarGzArchiver writes a gzip-compressed tar archive.
+type tarGzArchiver struct{}
+
+func (tarGzArchiver) Ext() string         { return ".tar.gz" }
+func (tarGzArchiver) ContentType() string { return "application/gzip" }
+
+func (tarGzArchiver) Write(w io.Writer, files []*File) error {
+	gzWriter := gzip.NewWriter(w)
+	defer gzWriter.Close()
+
+	tarWriter := tar.NewWriter(gzWriter)
+	defer tarWriter.Close()
+
+	return writeFilesToTar(tarWriter, files)
+}
+
+// writeFilesToTar streams each file's temp-file contents into a tar entry.
+func writeFilesToTar(tarWriter *tar.Writer, files []*File) error {
+	for _, file := range files {
+		name := filepath.Base(file.Filename)
+		header := &tar.Header{
+			Name: name,
+			Size: file.Size,
+			Mode: TarFileMode,
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("add %s to archive: %w", name, err)
+		}
+
+		if err := copyFileInto(tarWriter, file); err != nil {
+			return fmt.Errorf("write %s to archive: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// copyFileInto streams a downloaded file's temp-file contents into dst using
+// a pooled 32 KiB buffer, so archive creation never has to hold a whole file
+// in memory.
+func copyFileInto(dst io.Writer, file *File) error {
+	src, err := os.Open(file.TempPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	bufPtr, ok := copyBufferPool.Get().(*[]byte)
+	if !ok {
+		return fmt.Errorf("copy buffer pool returned unexpected type")
+	}
+	defer copyBufferPool.Put(bufPtr)
+
+	_, err = io.CopyBuffer(dst, src, *bufPtr)
+
+	return err
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DialTimeout           = 30 * time.Second
+	TLSHandshakeTimeout   = 10 * time.Second
+	ResponseHeaderTimeout = 30 * time.Second
+	AttemptTimeout        = 10 * time.Minute
+	MaxDownloadRetries    = 4
+	RetryBaseDelay        = 500 * time.Millisecond
+	HostRateLimitPerSec   = 5
+	HostRateLimitBurst    = 5
+)
+
+// sharedHTTPClient is reused across all downloads so dial/handshake pooling
+// and the tuned timeouts below apply uniformly, mirroring the gitlab-workhorse
+// zip fetcher's transport settings.
+var sharedHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: DialTimeout,
+		}).DialContext,
+		TLSHandshakeTimeout:   TLSHandshakeTimeout,
+		ResponseHeaderTimeout: ResponseHeaderTimeout,
+	},
+}
+
+// tokenBucket is a minimal per-host rate limiter: it refills at rate tokens
+// per second up to capacity, and reports how long a caller must wait before
+// its next request is allowed.
+type tokenBucket struct {
+	mu       sync.Mutex
+	tokens   float64
+	capacity float64
+	rate     float64
+	last     time.Time
+}
+
+func newTokenBucket(rate, capacity float64) *tokenBucket {
+	return &tokenBucket{tokens: capacity, capacity: capacity, rate: rate, last: time.Now()}
+}
+
+// reserve takes one token, refilling for elapsed time first, and returns how
+// long the caller should wait before proceeding.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+
+		return 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	b.tokens = 0
+
+	return wait
+}
+
+var (
+	hostLimiters   = make(map[string]*tokenBucket)
+	hostLimitersMu sync.Mutex
+)
+
+// hostLimiterFor returns the shared token bucket for a URL's host, creating
+// one on first use so a task pulling many files from one origin can't
+// hammer it.
+func hostLimiterFor(rawURL string) *tokenBucket {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	hostLimitersMu.Lock()
+	defer hostLimitersMu.Unlock()
+
+	limiter, ok := hostLimiters[host]
+	if !ok {
+		limiter = newTokenBucket(HostRateLimitPerSec, HostRateLimitBurst)
+		hostLimiters[host] = limiter
+	}
+
+	return limiter
+}
+
+// isRetryableStatus reports whether an HTTP response status is worth
+// retrying (server-side failures), as opposed to a client error that will
+// never succeed on retry.
+func isRetryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError
+}
+
+// downloadFile streams the HTTP body for rawURL into a temp file under
+// config.TempFolder instead of buffering it in memory. It retries on
+// network errors and 5xx responses with exponential backoff, resuming from
+// where a prior attempt left off via a conditional Range request, and rate
+// limits requests per host. It returns the temp file path, the derived
+// filename, the file size, and the number of retries performed.
+func downloadFile(rawURL string) (string, string, int64, int, error) {
+	tmpFile, err := os.CreateTemp(config.TempFolder, "download-*.tmp")
+	if err != nil {
+		return "", "", 0, 0, err
+	}
+	tmpFile.Close()
+
+	tmpPath := tmpFile.Name()
+	limiter := hostLimiterFor(rawURL)
+
+	var lastErr error
+
+	retries := 0
+	validator := ""
+
+	for attempt := 0; attempt <= MaxDownloadRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(RetryBaseDelay * time.Duration(math.Pow(2, float64(attempt-1))))
+			retries++
+		}
+
+		time.Sleep(limiter.reserve())
+
+		size, retryable, newValidator, err := attemptDownload(rawURL, tmpPath, validator)
+		validator = newValidator
+		if err == nil {
+			filename := filepath.Base(rawURL)
+			if filename == "." || filename == "/" {
+				filename = "file" + filepath.Ext(rawURL)
+			}
+
+			return tmpPath, filename, size, retries, nil
+		}
+
+		lastErr = err
+		if !retryable {
+			break
+		}
+	}
+
+	os.Remove(tmpPath)
+
+	return "", "", 0, retries, lastErr
+}
+
+// attemptDownload performs a single download attempt, resuming from the
+// existing contents of tmpPath via a conditional Range request (guarded by
+// If-Range against the validator returned by a prior attempt) when it's
+// non-empty. It returns the total file size on success, whether a failure
+// is worth retrying, and the validator (ETag or Last-Modified) to pass to
+// the next attempt.
+func attemptDownload(rawURL, tmpPath, validator string) (int64, bool, string, error) {
+	resumeFrom := int64(0)
+	if info, err := os.Stat(tmpPath); err == nil {
+		resumeFrom = info.Size()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), AttemptTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, false, validator, err
+	}
+
+	if resumeFrom > 0 && validator != "" {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeFrom))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return 0, true, validator, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// Either a fresh download or the server ignored/invalidated our
+		// If-Range; either way, start this file over from scratch.
+		resumeFrom = 0
+	case http.StatusPartialContent:
+		// Resuming as requested; the validator still matched.
+	default:
+		if isRetryableStatus(resp.StatusCode) {
+			return 0, true, validator, fmt.Errorf("HTTP status %d", resp.StatusCode)
+		}
+
+		return 0, false, validator, fmt.Errorf("HTTP status %d", resp.StatusCode)
+	}
+
+	if newValidator := resp.Header.Get("ETag"); newValidator != "" {
+		validator = newValidator
+	} else if newValidator := resp.Header.Get("Last-Modified"); newValidator != "" {
+		validator = newValidator
+	}
+
+	remainingCap := config.MaxFileSizeBytes - resumeFrom + 1
+	if resp.ContentLength > 0 && resp.ContentLength > remainingCap {
+		return 0, false, validator, fmt.Errorf("file size exceeds limit of %d bytes", config.MaxFileSizeBytes)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if resumeFrom > 0 {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	out, err := os.OpenFile(tmpPath, flags, MetadataFilePerm)
+	if err != nil {
+		return 0, false, validator, err
+	}
+	defer out.Close()
+
+	written, err := io.Copy(out, io.LimitReader(resp.Body, remainingCap))
+	if err != nil {
+		// Leave the partial file in place so the next attempt can resume.
+		return 0, true, validator, err
+	}
+
+	total := resumeFrom + written
+	if total > config.MaxFileSizeBytes {
+		return 0, false, validator, fmt.Errorf("file size exceeds limit of %d bytes", config.MaxFileSizeBytes)
+	}
+
+	return total, false, validator, nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// Inspector extracts preview metadata from a downloaded file so a UI can
+// show archive contents before download, without unpacking the archive.
+type Inspector interface {
+	Inspect(path string) (map[string]any, error)
+}
+
+// inspectors maps a lowercased file extension to the Inspector that knows
+// how to read that format.
+var inspectors = map[string]Inspector{
+	".pdf":  pdfInspector{},
+	".jpeg": jpegInspector{},
+	".jpg":  jpegInspector{},
+	".apk":  apkInspector{},
+}
+
+// inspectFile runs the Inspector registered for filename's extension, if
+// any. It returns a nil map (not an error) when no inspector is registered,
+// since most files simply have no extra metadata to surface.
+func inspectFile(path, filename string) (map[string]any, error) {
+	inspector, ok := inspectors[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return nil, nil
+	}
+
+	return inspector.Inspect(path)
+}
+
+// pdfInspector does a lightweight scan of the raw PDF bytes for the page
+// count and document title, without a full PDF object-graph parser.
+type pdfInspector struct{}
+
+var (
+	pdfPageRe  = regexp.MustCompile(`/Type\s*/Page[^s]`)
+	pdfTitleRe = regexp.MustCompile(`/Title\s*\(([^)]*)\)`)
+)
+
+func (pdfInspector) Inspect(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]any{
+		"pages": len(pdfPageRe.FindAll(data, -1)),
+	}
+
+	if match := pdfTitleRe.FindSubmatch(data); match != nil {
+		metadata["title"] = string(match[1])
+	}
+
+	return metadata, nil
+}
+
+// jpegInspector reads JPEG dimensions via the stdlib decoder and the EXIF
+// orientation tag via a minimal APP1 segment scan.
+type jpegInspector struct{}
+
+func (jpegInspector) Inspect(path string) (map[string]any, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("decode jpeg config: %w", err)
+	}
+
+	metadata := map[string]any{
+		"width":  config.Width,
+		"height": config.Height,
+	}
+
+	if orientation, err := jpegExifOrientation(path); err == nil {
+		metadata["orientation"] = orientation
+	}
+
+	return metadata, nil
+}
+
+// jpegExifOrientation extracts the EXIF orientation tag (0x0112) from a
+// JPEG's APP1 segment without a full EXIF decoder.
+func jpegExifOrientation(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	idx := bytes.Index(data, []byte("Exif\x00\x00"))
+	if idx < 0 {
+		return 0, fmt.Errorf("no EXIF segment found")
+	}
+
+	tiff := data[idx+6:]
+	if len(tiff) < 8 {
+		return 0, fmt.Errorf("truncated EXIF segment")
+	}
+
+	var byteOrder func([]byte) uint16
+	var byteOrder32 func([]byte) uint32
+
+	switch string(tiff[0:2]) {
+	case "II":
+		byteOrder = func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
+		byteOrder32 = func(b []byte) uint32 { return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24 }
+	case "MM":
+		byteOrder = func(b []byte) uint16 { return uint16(b[1]) | uint16(b[0])<<8 }
+		byteOrder32 = func(b []byte) uint32 { return uint32(b[3]) | uint32(b[2])<<8 | uint32(b[1])<<16 | uint32(b[0])<<24 }
+	default:
+		return 0, fmt.Errorf("unrecognized TIFF byte order")
+	}
+
+	ifdOffset := byteOrder32(tiff[4:8])
+	if int(ifdOffset)+2 > len(tiff) {
+		return 0, fmt.Errorf("IFD offset out of range")
+	}
+
+	entryCount := int(byteOrder(tiff[ifdOffset : ifdOffset+2]))
+	const entrySize = 12
+
+	for i := 0; i < entryCount; i++ {
+		offset := int(ifdOffset) + 2 + i*entrySize
+		if offset+entrySize > len(tiff) {
+			break
+		}
+
+		tag := byteOrder(tiff[offset : offset+2])
+		if tag == 0x0112 {
+			return int(byteOrder(tiff[offset+8 : offset+10])), nil
+		}
+	}
+
+	return 0, fmt.Errorf("orientation tag not found")
+}
+
+// apkInspector reports the APK's entry count and, when present, the package
+// name, version name and version code read out of AndroidManifest.xml's
+// binary XML (AXML) encoding.
+//
+// gohttpserver's ApkInfo does this via github.com/shogo82148/androidbinary/apk;
+// this module has no go.mod/vendoring to pull that dependency in, so the AXML
+// decoding below is hand-rolled instead. Noting it explicitly since it's a
+// deliberate scope deviation from that precedent, not an oversight.
+type apkInspector struct{}
+
+func (apkInspector) Inspect(path string) (map[string]any, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("open apk as zip: %w", err)
+	}
+	defer reader.Close()
+
+	var manifestFile *zip.File
+
+	for _, f := range reader.File {
+		if f.Name == "AndroidManifest.xml" {
+			manifestFile = f
+
+			break
+		}
+	}
+
+	metadata := map[string]any{
+		"entry_count":  len(reader.File),
+		"has_manifest": manifestFile != nil,
+	}
+
+	if manifestFile == nil {
+		return metadata, nil
+	}
+
+	rc, err := manifestFile.Open()
+	if err != nil {
+		return metadata, nil
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, MaxManifestBytes))
+	if err != nil {
+		return metadata, nil
+	}
+
+	manifest, err := parseAndroidManifest(data)
+	if err != nil {
+		return metadata, nil
+	}
+
+	for k, v := range manifest {
+		metadata[k] = v
+	}
+
+	return metadata, nil
+}
+
+// MaxManifestBytes bounds how much of an AndroidManifest.xml entry
+// apkInspector will decompress and hold in memory, since the entry's
+// compressed size on disk isn't a reliable bound on its inflated size.
+const MaxManifestBytes = 2 * 1024 * 1024
+
+// Android binary XML (AXML) chunk types, as defined by
+// frameworks/base/libs/androidfw/include/androidfw/ResourceTypes.h.
+const (
+	axmlChunkStringPool  = 0x0001
+	axmlChunkStartElem   = 0x0102
+	axmlStringPoolUTF8   = 1 << 8
+	axmlTypeString       = 0x03
+	axmlTypeIntDec       = 0x10
+	axmlTypeIntHex       = 0x11
+	axmlTypeIntBoolean   = 0x12
+	axmlAttrStructSize   = 20
+	axmlChunkHeaderSize  = 8
+	axmlStringPoolHeader = 20
+)
+
+// axmlAttribute is one attribute of an AXML start-element node, resolved
+// against the document's string pool.
+type axmlAttribute struct {
+	name  string
+	value any
+}
+
+// parseAndroidManifest walks an AndroidManifest.xml's AXML chunks far enough
+// to resolve the root <manifest> element's package, versionName and
+// versionCode attributes. It does not attempt to parse the full document
+// tree; any other element is skipped.
+func parseAndroidManifest(data []byte) (map[string]any, error) {
+	if len(data) < axmlChunkHeaderSize {
+		return nil, fmt.Errorf("manifest too short")
+	}
+
+	var pool []string
+
+	offset := axmlChunkHeaderSize
+	for offset+axmlChunkHeaderSize <= len(data) {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		headerSize := binary.LittleEndian.Uint16(data[offset+2:])
+		chunkSize := binary.LittleEndian.Uint32(data[offset+4:])
+
+		if chunkSize < axmlChunkHeaderSize || offset+int(chunkSize) > len(data) {
+			break
+		}
+
+		chunk := data[offset : offset+int(chunkSize)]
+
+		switch chunkType {
+		case axmlChunkStringPool:
+			if strs, err := parseAXMLStringPool(chunk); err == nil {
+				pool = strs
+			}
+		case axmlChunkStartElem:
+			name, attrs, err := parseAXMLStartElement(chunk, int(headerSize), pool)
+			if err == nil && name == "manifest" {
+				result := map[string]any{}
+
+				for _, attr := range attrs {
+					switch attr.name {
+					case "package":
+						result["package"] = attr.value
+					case "versionName":
+						result["version_name"] = attr.value
+					case "versionCode":
+						result["version_code"] = attr.value
+					}
+				}
+
+				return result, nil
+			}
+		}
+
+		offset += int(chunkSize)
+	}
+
+	return nil, fmt.Errorf("manifest element not found")
+}
+
+// parseAXMLStringPool decodes an AXML RES_STRING_POOL_TYPE chunk into its
+// list of strings, handling both the UTF-8 and UTF-16 pool encodings.
+func parseAXMLStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < axmlChunkHeaderSize+axmlStringPoolHeader {
+		return nil, fmt.Errorf("string pool chunk too short")
+	}
+
+	stringCount := binary.LittleEndian.Uint32(chunk[8:])
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := binary.LittleEndian.Uint32(chunk[20:])
+	isUTF8 := flags&axmlStringPoolUTF8 != 0
+
+	const offsetsStart = 28
+
+	// Each string has at least a 4-byte offset entry, so stringCount can
+	// never legitimately exceed the space left for the offsets array; clamp
+	// it before preallocating so a crafted chunk can't force a huge alloc.
+	if maxStrings := (len(chunk) - offsetsStart) / 4; maxStrings >= 0 && int(stringCount) > maxStrings {
+		stringCount = uint32(maxStrings)
+	}
+
+	pool := make([]string, 0, stringCount)
+
+	for i := 0; i < int(stringCount); i++ {
+		pos := offsetsStart + i*4
+		if pos+4 > len(chunk) {
+			break
+		}
+
+		strOffset := binary.LittleEndian.Uint32(chunk[pos:])
+		start := int(stringsStart) + int(strOffset)
+
+		if start >= len(chunk) {
+			pool = append(pool, "")
+
+			continue
+		}
+
+		s, err := decodeAXMLString(chunk[start:], isUTF8)
+		if err != nil {
+			s = ""
+		}
+
+		pool = append(pool, s)
+	}
+
+	return pool, nil
+}
+
+// decodeAXMLString decodes a single length-prefixed AXML pool string
+// starting at b, in either the UTF-8 or UTF-16LE pool encoding.
+func decodeAXMLString(b []byte, isUTF8 bool) (string, error) {
+	if isUTF8 {
+		_, charLenBytes := readAXMLLen8(b)
+		byteLen, byteLenBytes := readAXMLLen8(b[charLenBytes:])
+		start := charLenBytes + byteLenBytes
+		end := start + byteLen
+
+		if end > len(b) {
+			return "", fmt.Errorf("utf-8 string out of range")
+		}
+
+		return string(b[start:end]), nil
+	}
+
+	charLen, n := readAXMLLen16(b)
+	start := n
+	end := start + charLen*2
+
+	if end > len(b) {
+		return "", fmt.Errorf("utf-16 string out of range")
+	}
+
+	units := make([]uint16, charLen)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[start+i*2:])
+	}
+
+	return string(utf16.Decode(units)), nil
+}
+
+// readAXMLLen8 reads an AXML UTF-8 pool length field: one byte, or two when
+// the high bit of the first byte marks a 15-bit length. It returns the
+// decoded length and the number of bytes consumed.
+func readAXMLLen8(b []byte) (int, int) {
+	if len(b) == 0 {
+		return 0, 0
+	}
+
+	if b[0]&0x80 != 0 {
+		if len(b) < 2 {
+			return 0, 1
+		}
+
+		return int(b[0]&0x7f)<<8 | int(b[1]), 2
+	}
+
+	return int(b[0]), 1
+}
+
+// readAXMLLen16 reads an AXML UTF-16 pool length field: one uint16, or two
+// when the high bit marks a 31-bit length. It returns the decoded length and
+// the number of bytes consumed.
+func readAXMLLen16(b []byte) (int, int) {
+	if len(b) < 2 {
+		return 0, 0
+	}
+
+	first := binary.LittleEndian.Uint16(b)
+	if first&0x8000 != 0 {
+		if len(b) < 4 {
+			return 0, 2
+		}
+
+		second := binary.LittleEndian.Uint16(b[2:])
+
+		return int(first&0x7fff)<<16 | int(second), 4
+	}
+
+	return int(first), 2
+}
+
+// parseAXMLStartElement decodes an AXML RES_XML_START_ELEMENT_TYPE chunk,
+// resolving the element name and its attributes' names and values against
+// pool.
+func parseAXMLStartElement(chunk []byte, headerSize int, pool []string) (string, []axmlAttribute, error) {
+	if headerSize <= 0 || headerSize+axmlAttrStructSize > len(chunk) {
+		return "", nil, fmt.Errorf("start element chunk too short")
+	}
+
+	body := chunk[headerSize:]
+
+	nameIdx := int32(binary.LittleEndian.Uint32(body[4:8]))
+	attrsOffset := int(binary.LittleEndian.Uint16(body[8:10]))
+	attrSize := int(binary.LittleEndian.Uint16(body[10:12]))
+	attrCount := int(binary.LittleEndian.Uint16(body[12:14]))
+
+	name := poolString(pool, nameIdx)
+	attrs := make([]axmlAttribute, 0, attrCount)
+
+	for i := 0; i < attrCount; i++ {
+		start := attrsOffset + i*attrSize
+		if start+axmlAttrStructSize > len(body) {
+			break
+		}
+
+		a := body[start : start+axmlAttrStructSize]
+
+		attrNameIdx := int32(binary.LittleEndian.Uint32(a[4:8]))
+		rawValueIdx := int32(binary.LittleEndian.Uint32(a[8:12]))
+		dataType := a[15]
+		data := int32(binary.LittleEndian.Uint32(a[16:20]))
+
+		attrs = append(attrs, axmlAttribute{
+			name:  poolString(pool, attrNameIdx),
+			value: resolveAXMLAttrValue(pool, rawValueIdx, dataType, data),
+		})
+	}
+
+	return name, attrs, nil
+}
+
+// poolString looks up idx in pool, returning "" for an out-of-range or
+// negative (absent) index.
+func poolString(pool []string, idx int32) string {
+	if idx < 0 || int(idx) >= len(pool) {
+		return ""
+	}
+
+	return pool[idx]
+}
+
+// resolveAXMLAttrValue returns an attribute's value: the raw string when the
+// attribute carries one directly, otherwise the typed value decoded
+// according to dataType.
+func resolveAXMLAttrValue(pool []string, rawValueIdx int32, dataType byte, data int32) any {
+	if rawValueIdx >= 0 && int(rawValueIdx) < len(pool) {
+		return pool[rawValueIdx]
+	}
+
+	switch dataType {
+	case axmlTypeString:
+		return poolString(pool, data)
+	case axmlTypeIntDec, axmlTypeIntHex:
+		return int(data)
+	case axmlTypeIntBoolean:
+		return data != 0
+	default:
+		return int(data)
+	}
+}
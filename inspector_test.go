@@ -0,0 +1,277 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFixture(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write fixture: %v", err)
+	}
+
+	return path
+}
+
+func TestPDFInspector(t *testing.T) {
+	data := []byte("%PDF-1.4\n" +
+		"1 0 obj << /Type /Page >> endobj\n" +
+		"2 0 obj << /Type /Page >> endobj\n" +
+		"3 0 obj << /Title (Sample Document) >> endobj\n" +
+		"%%EOF")
+	path := writeFixture(t, "fixture.pdf", data)
+
+	metadata, err := (pdfInspector{}).Inspect(path)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	if metadata["pages"] != 2 {
+		t.Errorf("pages = %v, want 2", metadata["pages"])
+	}
+
+	if metadata["title"] != "Sample Document" {
+		t.Errorf("title = %q, want %q", metadata["title"], "Sample Document")
+	}
+}
+
+// buildJPEGWithOrientation encodes a tiny JPEG and splices in a hand-built
+// EXIF APP1 segment carrying a single orientation tag, so jpegInspector can
+// be exercised against both the stdlib decoder path and the manual EXIF scan.
+func buildJPEGWithOrientation(t *testing.T, orientation uint16) []byte {
+	t.Helper()
+
+	img := image.NewGray(image.Rect(0, 0, 6, 4))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+
+	encoded := buf.Bytes()
+
+	tiff := make([]byte, 8)
+	copy(tiff, "II")
+	binary.LittleEndian.PutUint16(tiff[2:], 42)
+	binary.LittleEndian.PutUint32(tiff[4:], 8)
+
+	ifd := make([]byte, 0, 18)
+	ifd = binary.LittleEndian.AppendUint16(ifd, 1) // one entry
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112) // orientation tag
+	binary.LittleEndian.PutUint16(entry[2:], 3)      // type SHORT
+	binary.LittleEndian.PutUint32(entry[4:], 1)      // count
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	ifd = append(ifd, entry...)
+	ifd = binary.LittleEndian.AppendUint32(ifd, 0) // no next IFD
+
+	payload := append([]byte("Exif\x00\x00"), append(tiff, ifd...)...)
+
+	app1 := make([]byte, 0, 4+len(payload))
+	app1 = append(app1, 0xFF, 0xE1)
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	fixture := make([]byte, 0, len(encoded)+len(app1))
+	fixture = append(fixture, encoded[:2]...) // SOI
+	fixture = append(fixture, app1...)
+	fixture = append(fixture, encoded[2:]...)
+
+	return fixture
+}
+
+func TestJPEGInspector(t *testing.T) {
+	path := writeFixture(t, "fixture.jpg", buildJPEGWithOrientation(t, 3))
+
+	metadata, err := (jpegInspector{}).Inspect(path)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	if metadata["width"] != 6 || metadata["height"] != 4 {
+		t.Errorf("dimensions = %vx%v, want 6x4", metadata["width"], metadata["height"])
+	}
+
+	if metadata["orientation"] != 3 {
+		t.Errorf("orientation = %v, want 3", metadata["orientation"])
+	}
+}
+
+// axmlString encodes a single string in the AXML UTF-8 string pool encoding:
+// a one-byte char count, a one-byte byte count, the bytes themselves, and a
+// NUL terminator.
+func axmlString(s string) []byte {
+	return append([]byte{byte(len(s)), byte(len(s))}, append([]byte(s), 0)...)
+}
+
+// buildAXMLStringPool builds a minimal UTF-8-flavored AXML string pool chunk
+// containing strs, in order.
+func buildAXMLStringPool(strs []string) []byte {
+	offsetsStart := 28
+	stringsStart := offsetsStart + 4*len(strs)
+
+	var data []byte
+
+	offsets := make([]uint32, len(strs))
+
+	for i, s := range strs {
+		offsets[i] = uint32(len(data))
+		data = append(data, axmlString(s)...)
+	}
+
+	chunk := make([]byte, stringsStart)
+	binary.LittleEndian.PutUint16(chunk[0:], 0x0001)            // type
+	binary.LittleEndian.PutUint16(chunk[2:], 28)                // headerSize
+	binary.LittleEndian.PutUint32(chunk[8:], uint32(len(strs))) // stringCount
+	binary.LittleEndian.PutUint32(chunk[16:], 1<<8)             // flags: UTF8
+	binary.LittleEndian.PutUint32(chunk[20:], uint32(stringsStart))
+
+	for i, off := range offsets {
+		binary.LittleEndian.PutUint32(chunk[offsetsStart+i*4:], off)
+	}
+
+	chunk = append(chunk, data...)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(chunk))) // size
+
+	return chunk
+}
+
+// axmlAttrBytes encodes one 20-byte AXML attribute struct.
+func axmlAttrBytes(nameIdx, rawValueIdx int32, dataType byte, data int32) []byte {
+	noNamespace := int32(-1)
+
+	a := make([]byte, 20)
+	binary.LittleEndian.PutUint32(a[0:], uint32(noNamespace)) // namespaceURI
+	binary.LittleEndian.PutUint32(a[4:], uint32(nameIdx))
+	binary.LittleEndian.PutUint32(a[8:], uint32(rawValueIdx))
+	binary.LittleEndian.PutUint16(a[12:], 8) // typedValue.size
+	a[14] = 0                                // res0
+	a[15] = dataType
+	binary.LittleEndian.PutUint32(a[16:], uint32(data))
+
+	return a
+}
+
+// buildManifestStartElement builds a RES_XML_START_ELEMENT_TYPE chunk for a
+// <manifest> element carrying the given attributes.
+func buildManifestStartElement(manifestNameIdx int32, attrs [][]byte) []byte {
+	const headerSize = 16
+
+	noNamespace := int32(-1)
+
+	body := make([]byte, 20)
+	binary.LittleEndian.PutUint32(body[0:], uint32(noNamespace)) // namespaceURI
+	binary.LittleEndian.PutUint32(body[4:], uint32(manifestNameIdx))
+	binary.LittleEndian.PutUint16(body[8:], 20)  // attributeStart
+	binary.LittleEndian.PutUint16(body[10:], 20) // attributeSize
+	binary.LittleEndian.PutUint16(body[12:], uint16(len(attrs)))
+
+	for _, attr := range attrs {
+		body = append(body, attr...)
+	}
+
+	chunk := make([]byte, headerSize)
+	binary.LittleEndian.PutUint16(chunk[0:], 0x0102) // type
+	binary.LittleEndian.PutUint16(chunk[2:], headerSize)
+	binary.LittleEndian.PutUint32(chunk[8:], 1)           // lineNumber
+	binary.LittleEndian.PutUint32(chunk[12:], 0xFFFFFFFF) // comment
+	chunk = append(chunk, body...)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(chunk))) // size
+
+	return chunk
+}
+
+// buildFixtureManifest assembles a minimal but structurally real
+// AndroidManifest.xml AXML document declaring package, versionName and
+// versionCode on the root <manifest> element.
+func buildFixtureManifest() []byte {
+	pool := []string{"manifest", "package", "com.example.app", "versionName", "1.2.3", "versionCode"}
+	stringPool := buildAXMLStringPool(pool)
+
+	attrs := [][]byte{
+		axmlAttrBytes(1, 2, axmlTypeString, -1), // package="com.example.app" (raw string)
+		axmlAttrBytes(3, -1, axmlTypeString, 4), // versionName="1.2.3" (typed string)
+		axmlAttrBytes(5, -1, axmlTypeIntDec, 7), // versionCode=7 (typed int)
+	}
+	startElement := buildManifestStartElement(0, attrs)
+
+	doc := make([]byte, 8)
+	binary.LittleEndian.PutUint16(doc[0:], 0x0003) // RES_XML_TYPE
+	binary.LittleEndian.PutUint16(doc[2:], 8)
+	doc = append(doc, stringPool...)
+	doc = append(doc, startElement...)
+	binary.LittleEndian.PutUint32(doc[4:], uint32(len(doc)))
+
+	return doc
+}
+
+func TestAPKInspector(t *testing.T) {
+	path := writeFixture(t, "fixture.apk", nil)
+
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create fixture: %v", err)
+	}
+
+	zipWriter := zip.NewWriter(out)
+
+	manifestWriter, err := zipWriter.Create("AndroidManifest.xml")
+	if err != nil {
+		t.Fatalf("create manifest entry: %v", err)
+	}
+
+	if _, err := manifestWriter.Write(buildFixtureManifest()); err != nil {
+		t.Fatalf("write manifest entry: %v", err)
+	}
+
+	resWriter, err := zipWriter.Create("res/values/strings.xml")
+	if err != nil {
+		t.Fatalf("create resource entry: %v", err)
+	}
+
+	if _, err := resWriter.Write([]byte("<resources/>")); err != nil {
+		t.Fatalf("write resource entry: %v", err)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	if err := out.Close(); err != nil {
+		t.Fatalf("close fixture: %v", err)
+	}
+
+	metadata, err := (apkInspector{}).Inspect(path)
+	if err != nil {
+		t.Fatalf("Inspect: %v", err)
+	}
+
+	if metadata["entry_count"] != 2 {
+		t.Errorf("entry_count = %v, want 2", metadata["entry_count"])
+	}
+
+	if metadata["has_manifest"] != true {
+		t.Errorf("has_manifest = %v, want true", metadata["has_manifest"])
+	}
+
+	if metadata["package"] != "com.example.app" {
+		t.Errorf("package = %v, want com.example.app", metadata["package"])
+	}
+
+	if metadata["version_name"] != "1.2.3" {
+		t.Errorf("version_name = %v, want 1.2.3", metadata["version_name"])
+	}
+
+	if metadata["version_code"] != 7 {
+		t.Errorf("version_code = %v, want 7", metadata["version_code"])
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"archive/zip"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,10 +15,16 @@ import (
 )
 
 const (
-	MaxActiveTasks  = 3
-	MaxFilesPerTask = 3
-	MkDirPerm       = 0755
-	TaskIDPathParts = 3
+	MaxActiveTasks         = 3
+	MaxFilesPerTask        = 3
+	MkDirPerm              = 0755
+	TaskIDPathParts        = 3
+	DefaultTTLSeconds      = 24 * 60 * 60
+	MetadataFilePerm       = 0644
+	MetadataFileSuffix     = ".metadata"
+	MaxFileSizeBytes       = 200 * 1024 * 1024
+	CopyBufferSize         = 32 * 1024
+	DefaultDownloadWorkers = 4
 )
 
 // Config app configs.
@@ -29,6 +34,9 @@ type Config struct {
 	MaxActiveTasks    int
 	TempFolder        string
 	ServerPort        string
+	DefaultTTLSeconds int
+	MaxFileSizeBytes  int64
+	DownloadWorkers   int
 }
 
 var (
@@ -37,47 +45,116 @@ var (
 			".pdf":  true,
 			".jpeg": true,
 			".jpg":  true,
+			".apk":  true,
 		},
-		MaxFilesPerTask: MaxFilesPerTask,
-		MaxActiveTasks:  MaxActiveTasks,
-		TempFolder:      "temp_archives",
-		ServerPort:      "8080",
+		MaxFilesPerTask:   MaxFilesPerTask,
+		MaxActiveTasks:    MaxActiveTasks,
+		TempFolder:        "temp_archives",
+		ServerPort:        "8080",
+		DefaultTTLSeconds: DefaultTTLSeconds,
+		MaxFileSizeBytes:  MaxFileSizeBytes,
+		DownloadWorkers:   DefaultDownloadWorkers,
 	}
 
-	tasks      = make(map[string]*Task)
-	tasksMutex sync.Mutex
-	taskSem    chan struct{}
+	tasks       = make(map[string]*Task)
+	tasksMutex  sync.Mutex
+	taskSem     chan struct{}
+	downloadSem chan struct{}
+
+	// copyBufferPool holds reusable 32 KiB buffers for streaming file bytes
+	// into zip entries without allocating per file.
+	copyBufferPool = sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, CopyBufferSize)
+
+			return &buf
+		},
+	}
 )
 
 // Task create archives.
 type Task struct {
-	ID        string
-	Status    string
-	Files     []File
-	Errors    []string
-	ZipPath   string
-	CreatedAt time.Time
-	Mutex     sync.Mutex
+	ID           string
+	Status       string
+	Files        []*File
+	Finalized    bool
+	Errors       []TaskError
+	ArchivePath  string
+	Format       string
+	CreatedAt    time.Time
+	ContentType  string
+	Size         int64
+	Downloads    int
+	MaxDownloads int
+	ExpiresAt    time.Time
+	Mutex        sync.Mutex
+}
+
+// ArchiveMetadata is the JSON sidecar persisted next to every completed
+// archive so download limits and expiry survive a server restart.
+type ArchiveMetadata struct {
+	TaskID       string    `json:"task_id"`
+	ArchivePath  string    `json:"archive_path"`
+	Format       string    `json:"format"`
+	ContentType  string    `json:"content_type"`
+	CreatedAt    time.Time `json:"created_at"`
+	Size         int64     `json:"size"`
+	Downloads    int       `json:"downloads"`
+	MaxDownloads int       `json:"max_downloads"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// TaskError is a structured entry in Task.Errors, replacing ad-hoc
+// fmt-formatted strings so a client can distinguish retryable download
+// failures from one-off archive-building errors.
+type TaskError struct {
+	Message    string    `json:"message"`
+	URL        string    `json:"url,omitempty"`
+	Retries    int       `json:"retries,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// addTaskError appends a structured error to task.Errors. Callers must hold
+// task.Mutex.
+func addTaskError(task *Task, url, message string, retries int) {
+	task.Errors = append(task.Errors, TaskError{
+		Message:    message,
+		URL:        url,
+		Retries:    retries,
+		OccurredAt: time.Now(),
+	})
 }
 
-// File download files.
+// File download files. The bytes themselves live in TempPath on disk rather
+// than in memory so a task's RAM footprint doesn't grow with file size.
+// Status tracks its progress through the download worker pool: "pending",
+// "downloading", "done", or "failed".
 type File struct {
+	ID       string
 	URL      string
 	Filename string
-	Data     []byte
+	TempPath string
+	Size     int64
+	Metadata map[string]any
+	Status   string
+	Error    string
 }
 
 func init() {
 	taskSem = make(chan struct{}, config.MaxActiveTasks)
+	downloadSem = make(chan struct{}, config.DownloadWorkers)
 
 	if err := os.MkdirAll(config.TempFolder, MkDirPerm); err != nil {
 		panic(fmt.Sprintf("Failed to create temp folder: %v", err))
 	}
+
+	loadTasksFromMetadata()
 }
 
 func main() {
 	http.HandleFunc("/tasks", handleTasks)
 	http.HandleFunc("/tasks/", handleTaskFiles)
+	http.HandleFunc("/download/", handleDownload)
 
 	fmt.Printf("Server starting on port %s...\n", config.ServerPort)
 	if err := http.ListenAndServe(":"+config.ServerPort, nil); err != nil {
@@ -90,6 +167,11 @@ func generateTaskID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
+// generateFileID generates ID for a queued file download.
+func generateFileID() string {
+	return fmt.Sprintf("%d", time.Now().UnixNano())
+}
+
 // isValidURL checks is URL valid.
 func isValidURL(url string) bool {
 	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
@@ -103,13 +185,45 @@ func handleTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var request struct {
+		MaxDownloads int    `json:"max_downloads"`
+		TTLSeconds   int    `json:"ttl_seconds"`
+		Format       string `json:"format"`
+	}
+
+	if r.ContentLength > 0 {
+		if err := decodeJSONBody(w, r, &request); err != nil {
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if request.Format == "" {
+		request.Format = DefaultFormat
+	}
+
+	if _, err := archiverFor(request.Format); err != nil {
+		http.Error(w, `{"error": "Unsupported archive format"}`, http.StatusBadRequest)
+
+		return
+	}
+
+	ttlSeconds := request.TTLSeconds
+	if ttlSeconds <= 0 {
+		ttlSeconds = config.DefaultTTLSeconds
+	}
+
 	select {
 	case taskSem <- struct{}{}:
 		taskID := generateTaskID()
 		newTask := &Task{
-			ID:        taskID,
-			Status:    "created",
-			CreatedAt: time.Now(),
+			ID:           taskID,
+			Status:       "created",
+			CreatedAt:    time.Now(),
+			MaxDownloads: request.MaxDownloads,
+			Format:       request.Format,
+			ExpiresAt:    time.Now().Add(time.Duration(ttlSeconds) * time.Second),
 		}
 
 		tasksMutex.Lock()
@@ -129,7 +243,8 @@ func handleTasks(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleTaskFiles add files and check status.
+// handleTaskFiles routes /tasks/{id}, /tasks/{id}/files and
+// /tasks/{id}/finalize.
 func handleTaskFiles(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < TaskIDPathParts {
@@ -149,137 +264,493 @@ func handleTaskFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	switch r.Method {
-	case http.MethodPost:
-		task.Mutex.Lock()
-		defer task.Mutex.Unlock()
+	var subResource string
+	if len(pathParts) > TaskIDPathParts {
+		subResource = pathParts[3]
+	}
 
-		if len(task.Files) >= config.MaxFilesPerTask {
-			http.Error(w, `{"error": "Maximum files per task reached"}`, http.StatusBadRequest)
+	switch {
+	case subResource == "files" && r.Method == http.MethodPost:
+		handleAddFile(w, r, task)
+	case subResource == "finalize" && r.Method == http.MethodPost:
+		handleFinalizeTask(w, task)
+	case subResource == "" && r.Method == http.MethodGet:
+		handleTaskStatus(w, task)
+	case subResource == "" || subResource == "files" || subResource == "finalize":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
 
-			return
-		}
+// handleAddFile enqueues a URL for background download and returns
+// immediately with the file's ID and pending status.
+func handleAddFile(w http.ResponseWriter, r *http.Request, task *Task) {
+	task.Mutex.Lock()
 
-		var request struct {
-			URL string `json:"url"`
-		}
+	if task.Finalized || task.Status == "completed" || task.Status == "failed" {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "Task already finalized"}`, http.StatusBadRequest)
 
-		if err := decodeJSONBody(w, r, &request); err != nil {
-			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
 
-			return
-		}
+	if len(task.Files) >= config.MaxFilesPerTask {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "Maximum files per task reached"}`, http.StatusBadRequest)
 
-		if !isValidURL(request.URL) {
-			http.Error(w, `{"error": "Invalid URL"}`, http.StatusBadRequest)
+		return
+	}
 
-			return
-		}
+	var request struct {
+		URL string `json:"url"`
+	}
+
+	if err := decodeJSONBody(w, r, &request); err != nil {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
 
-		if !hasAllowedExtension(request.URL) {
-			http.Error(w, `{"error": "File type not allowed"}`, http.StatusBadRequest)
+		return
+	}
 
-			return
-		}
+	if !isValidURL(request.URL) {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "Invalid URL"}`, http.StatusBadRequest)
 
-		data, filename, err := downloadFile(request.URL)
-		if err != nil {
-			task.Errors = append(task.Errors, fmt.Sprintf("Failed to download %s: %v", request.URL, err))
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusAccepted)
-			_, err := fmt.Fprintf(w, `{"task_id": "%s", "status": "%s", "error": "Failed to download file, please, try other service"}`, task.ID, task.Status)
-			if err != nil {
-				fmt.Println("Failed to provide info for user: ", err)
+		return
+	}
 
-				return
-			}
+	if !hasAllowedExtension(request.URL) {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "File type not allowed"}`, http.StatusBadRequest)
 
-			return
-		}
+		return
+	}
+
+	file := &File{
+		ID:     generateFileID(),
+		URL:    request.URL,
+		Status: "pending",
+	}
+	task.Files = append(task.Files, file)
+	task.Mutex.Unlock()
+
+	go downloadAndProcessFile(task, file)
 
-		task.Files = append(task.Files, File{
-			URL:      request.URL,
-			Filename: filename,
-			Data:     data,
+	sendJSONResponse(w, http.StatusAccepted, map[string]interface{}{
+		"task_id": task.ID,
+		"file_id": file.ID,
+		"status":  file.Status,
+	})
+}
+
+// handleFinalizeTask closes a task to further files and, once any
+// in-flight downloads finish, triggers archive creation.
+func handleFinalizeTask(w http.ResponseWriter, task *Task) {
+	task.Mutex.Lock()
+
+	if task.Finalized || task.Status == "completed" || task.Status == "failed" {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "Task already finalized"}`, http.StatusBadRequest)
+
+		return
+	}
+
+	if len(task.Files) == 0 {
+		task.Mutex.Unlock()
+		http.Error(w, `{"error": "Task has no files"}`, http.StatusBadRequest)
+
+		return
+	}
+
+	task.Finalized = true
+	status := task.Status
+	task.Mutex.Unlock()
+
+	maybeStartArchive(task)
+
+	sendJSONResponse(w, http.StatusAccepted, map[string]interface{}{
+		"task_id": task.ID,
+		"status":  status,
+	})
+}
+
+// handleTaskStatus reports the task's overall status and the individual
+// status of every queued file.
+func handleTaskStatus(w http.ResponseWriter, task *Task) {
+	task.Mutex.Lock()
+	defer task.Mutex.Unlock()
+
+	files := make([]map[string]interface{}, 0, len(task.Files))
+	for _, file := range task.Files {
+		files = append(files, map[string]interface{}{
+			"file_id":  file.ID,
+			"filename": file.Filename,
+			"status":   file.Status,
+			"size":     file.Size,
+			"metadata": file.Metadata,
+			"error":    file.Error,
 		})
+	}
 
-		if len(task.Files) == config.MaxFilesPerTask {
-			task.Status = "processing"
-			go createZipArchive(task)
-		}
+	response := map[string]interface{}{
+		"task_id":     task.ID,
+		"status":      task.Status,
+		"finalized":   task.Finalized,
+		"files_count": len(task.Files),
+		"files":       files,
+		"errors":      task.Errors,
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusAccepted)
-		_, err = fmt.Fprintf(w, `{"task_id": "%s", "status": "%s", "files_count": %d}`, task.ID, task.Status, len(task.Files))
-		if err != nil {
-			fmt.Println("Failed to provide info to user: ", err)
+	if task.Status == "completed" && task.ArchivePath != "" {
+		response["download_url"] = fmt.Sprintf("/download/%s", task.ID)
+	}
 
-			return
-		}
+	sendJSONResponse(w, http.StatusOK, response)
+}
+
+// downloadAndProcessFile runs one queued file's download and inspection on
+// a bounded worker slot, then checks whether the task is ready to archive.
+func downloadAndProcessFile(task *Task, file *File) {
+	downloadSem <- struct{}{}
+	defer func() { <-downloadSem }()
+
+	task.Mutex.Lock()
+	file.Status = "downloading"
+	task.Mutex.Unlock()
+
+	tempPath, filename, size, retries, err := downloadFile(file.URL)
+	if err != nil {
+		task.Mutex.Lock()
+		file.Status = "failed"
+		file.Error = err.Error()
+		addTaskError(task, file.URL, fmt.Sprintf("Failed to download: %v", err), retries)
+		task.Mutex.Unlock()
+		maybeStartArchive(task)
 
-	case http.MethodGet:
+		return
+	}
+
+	metadata, err := inspectFile(tempPath, filename)
+	if err != nil {
 		task.Mutex.Lock()
-		defer task.Mutex.Unlock()
+		addTaskError(task, file.URL, fmt.Sprintf("Failed to inspect %s: %v", filename, err), 0)
+		task.Mutex.Unlock()
+	}
 
-		response := map[string]interface{}{
-			"task_id":     task.ID,
-			"status":      task.Status,
-			"files_count": len(task.Files),
-			"errors":      task.Errors,
-		}
+	task.Mutex.Lock()
+	file.Filename = filename
+	file.TempPath = tempPath
+	file.Size = size
+	file.Metadata = metadata
+	file.Status = "done"
+	task.Mutex.Unlock()
 
-		if task.Status == "completed" && task.ZipPath != "" {
-			response["download_url"] = fmt.Sprintf("/download/%s", filepath.Base(task.ZipPath))
-		}
+	maybeStartArchive(task)
+}
 
-		sendJSONResponse(w, http.StatusOK, response)
+// maybeStartArchive builds the task's archive once it has been finalized
+// and every queued file has reached a terminal (done/failed) state.
+func maybeStartArchive(task *Task) {
+	task.Mutex.Lock()
 
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if !task.Finalized || task.Status == "processing" || task.Status == "completed" {
+		task.Mutex.Unlock()
+
+		return
+	}
+
+	for _, file := range task.Files {
+		if file.Status == "pending" || file.Status == "downloading" {
+			task.Mutex.Unlock()
+
+			return
+		}
 	}
+
+	task.Status = "processing"
+	task.Mutex.Unlock()
+
+	go createZipArchive(task)
 }
 
-// createZipArchive create ZIP archive.
+// createZipArchive builds the task's archive by dispatching to the Archiver
+// registered for task.Format.
 func createZipArchive(task *Task) {
 	defer func() {
 		<-taskSem
 	}()
+	defer removeTempFiles(task)
+
+	doneFiles := make([]*File, 0, len(task.Files))
+	for _, file := range task.Files {
+		if file.Status == "done" {
+			doneFiles = append(doneFiles, file)
+		}
+	}
+
+	if len(doneFiles) == 0 {
+		task.Mutex.Lock()
+		task.Status = "failed"
+		addTaskError(task, "", "No files downloaded successfully; nothing to archive", 0)
+		task.Mutex.Unlock()
+
+		return
+	}
 
-	zipPath := filepath.Join(config.TempFolder, fmt.Sprintf("%s.zip", task.ID))
-	zipFile, err := os.Create(zipPath)
+	archiver, err := archiverFor(task.Format)
 	if err != nil {
 		task.Mutex.Lock()
 		task.Status = "failed"
-		task.Errors = append(task.Errors, fmt.Sprintf("Failed to create zip file: %v", err))
+		addTaskError(task, "", fmt.Sprintf("Failed to select archiver: %v", err), 0)
 		task.Mutex.Unlock()
 
 		return
 	}
-	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	archivePath := filepath.Join(config.TempFolder, task.ID+archiver.Ext())
 
-	for _, file := range task.Files {
-		fileWriter, err := zipWriter.Create(file.Filename)
+	archiveFile, err := os.Create(archivePath)
+	if err != nil {
+		task.Mutex.Lock()
+		task.Status = "failed"
+		addTaskError(task, "", fmt.Sprintf("Failed to create archive file: %v", err), 0)
+		task.Mutex.Unlock()
+
+		return
+	}
+	defer archiveFile.Close()
+
+	if err := archiver.Write(archiveFile, doneFiles); err != nil {
+		task.Mutex.Lock()
+		addTaskError(task, "", fmt.Sprintf("Failed to write archive: %v", err), 0)
+		task.Mutex.Unlock()
+	}
+
+	info, err := archiveFile.Stat()
+	if err != nil {
+		task.Mutex.Lock()
+		addTaskError(task, "", fmt.Sprintf("Failed to stat archive file: %v", err), 0)
+		task.Mutex.Unlock()
+
+		return
+	}
+
+	task.Mutex.Lock()
+	task.Status = "completed"
+	task.ArchivePath = archivePath
+	task.ContentType = archiver.ContentType()
+	task.Size = info.Size()
+	task.Mutex.Unlock()
+
+	if err := writeMetadataFile(task); err != nil {
+		task.Mutex.Lock()
+		addTaskError(task, "", fmt.Sprintf("Failed to write metadata file: %v", err), 0)
+		task.Mutex.Unlock()
+	}
+}
+
+// metadataPath returns the path to the metadata sidecar for a task.
+func metadataPath(taskID string) string {
+	return filepath.Join(config.TempFolder, taskID+MetadataFileSuffix)
+}
+
+// writeMetadataFileLocked persists a task's archive metadata to its JSON
+// sidecar. The caller must hold task.Mutex.
+func writeMetadataFileLocked(task *Task) error {
+	meta := ArchiveMetadata{
+		TaskID:       task.ID,
+		ArchivePath:  task.ArchivePath,
+		Format:       task.Format,
+		ContentType:  task.ContentType,
+		CreatedAt:    task.CreatedAt,
+		Size:         task.Size,
+		Downloads:    task.Downloads,
+		MaxDownloads: task.MaxDownloads,
+		ExpiresAt:    task.ExpiresAt,
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(metadataPath(task.ID), data, MetadataFilePerm)
+}
+
+// writeMetadataFile acquires task.Mutex and persists the metadata sidecar.
+func writeMetadataFile(task *Task) error {
+	task.Mutex.Lock()
+	defer task.Mutex.Unlock()
+
+	return writeMetadataFileLocked(task)
+}
+
+// loadTasksFromMetadata repopulates the in-memory tasks map from metadata
+// sidecars left on disk so a server restart doesn't lose completed archives.
+func loadTasksFromMetadata() {
+	entries, err := os.ReadDir(config.TempFolder)
+	if err != nil {
+		fmt.Println("Failed to read temp folder: ", err)
+
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), MetadataFileSuffix) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(config.TempFolder, entry.Name()))
 		if err != nil {
-			task.Mutex.Lock()
-			task.Errors = append(task.Errors, fmt.Sprintf("Failed to add file %s to archive: %v", file.Filename, err))
-			task.Mutex.Unlock()
+			fmt.Println("Failed to read metadata file: ", err)
+
 			continue
 		}
 
-		if _, err := fileWriter.Write(file.Data); err != nil {
-			task.Mutex.Lock()
-			task.Errors = append(task.Errors, fmt.Sprintf("Failed to write file %s to archive: %v", file.Filename, err))
-			task.Mutex.Unlock()
+		var meta ArchiveMetadata
+		if err := json.Unmarshal(data, &meta); err != nil {
+			fmt.Println("Failed to parse metadata file: ", err)
+
+			continue
+		}
+
+		if _, err := os.Stat(meta.ArchivePath); err != nil {
+			// Zip is gone but the sidecar remains; drop the stale sidecar.
+			os.Remove(filepath.Join(config.TempFolder, entry.Name()))
+
+			continue
+		}
+
+		tasks[meta.TaskID] = &Task{
+			ID:           meta.TaskID,
+			Status:       "completed",
+			Finalized:    true,
+			ArchivePath:  meta.ArchivePath,
+			Format:       meta.Format,
+			CreatedAt:    meta.CreatedAt,
+			ContentType:  meta.ContentType,
+			Size:         meta.Size,
+			Downloads:    meta.Downloads,
+			MaxDownloads: meta.MaxDownloads,
+			ExpiresAt:    meta.ExpiresAt,
 		}
 	}
+}
+
+// taskIDFromDownloadPath strips a client-supplied archive extension (e.g.
+// "<id>.tar.gz") from a /download/ path segment and returns the task ID
+// along with the extension found, if any, so the caller can verify it
+// matches the format the task was actually archived in.
+func taskIDFromDownloadPath(pathSuffix string) (string, string) {
+	for _, archiver := range archivers {
+		if trimmed := strings.TrimSuffix(pathSuffix, archiver.Ext()); trimmed != pathSuffix {
+			return trimmed, archiver.Ext()
+		}
+	}
+
+	if ext := filepath.Ext(pathSuffix); ext != "" {
+		return strings.TrimSuffix(pathSuffix, ext), ext
+	}
+
+	return pathSuffix, ""
+}
+
+// handleDownload serves a completed archive, enforcing download-count and
+// expiration limits, and removes both the archive and its metadata sidecar
+// once the last allowed download has been served.
+func handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	taskID, requestedExt := taskIDFromDownloadPath(strings.TrimPrefix(r.URL.Path, "/download/"))
+	if taskID == "" {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+
+		return
+	}
+
+	tasksMutex.Lock()
+	task, exists := tasks[taskID]
+	tasksMutex.Unlock()
+
+	if !exists {
+		http.Error(w, "Task not found", http.StatusNotFound)
+
+		return
+	}
 
 	task.Mutex.Lock()
-	task.Status = "completed"
-	task.ZipPath = zipPath
-	task.Mutex.Unlock()
+	defer task.Mutex.Unlock()
+
+	if task.Status != "completed" || task.ArchivePath == "" {
+		http.Error(w, `{"error": "Archive not ready"}`, http.StatusConflict)
+
+		return
+	}
+
+	if requestedExt != "" {
+		archiver, err := archiverFor(task.Format)
+		if err == nil && requestedExt != archiver.Ext() {
+			http.Error(w, fmt.Sprintf(`{"error": "Task was archived as %s, not %s"}`, task.Format, requestedExt), http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	if !task.ExpiresAt.IsZero() && time.Now().After(task.ExpiresAt) {
+		removeArchiveFiles(task)
+		http.Error(w, `{"error": "Archive expired"}`, http.StatusGone)
+
+		return
+	}
+
+	if task.MaxDownloads > 0 && task.Downloads >= task.MaxDownloads {
+		http.Error(w, `{"error": "Maximum downloads reached"}`, http.StatusGone)
+
+		return
+	}
+
+	task.Downloads++
+	last := task.MaxDownloads > 0 && task.Downloads >= task.MaxDownloads
+
+	w.Header().Set("Content-Type", task.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(task.ArchivePath)))
+	http.ServeFile(w, r, task.ArchivePath)
+
+	if last {
+		removeArchiveFiles(task)
+
+		return
+	}
+
+	if err := writeMetadataFileLocked(task); err != nil {
+		fmt.Println("Failed to update metadata file: ", err)
+	}
+}
+
+// removeArchiveFiles deletes a task's zip and metadata sidecar from disk and
+// drops the task from the in-memory map. Callers must hold task.Mutex.
+func removeArchiveFiles(task *Task) {
+	os.Remove(task.ArchivePath)
+	os.Remove(metadataPath(task.ID))
+
+	tasksMutex.Lock()
+	delete(tasks, task.ID)
+	tasksMutex.Unlock()
+}
+
+// removeTempFiles deletes the per-file temp downloads backing a task now
+// that they've been copied into the archive (or the archive failed).
+func removeTempFiles(task *Task) {
+	for _, file := range task.Files {
+		if file.TempPath != "" {
+			os.Remove(file.TempPath)
+		}
+	}
 }
 
 // parseURL decodes url and extract file name
@@ -310,36 +781,8 @@ func hasAllowedExtension(rawURL string) bool {
 	}
 
 	ext := strings.ToLower(filepath.Ext(filename))
-	if ext == ".jpeg" || ext == ".jpg" || ext == ".pdf" {
-		return true
-	}
-
-	return false
-}
-
-// downloadFile downloads file.
-func downloadFile(url string) ([]byte, string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("HTTP status %d", resp.StatusCode)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, "", err
-	}
-
-	filename := filepath.Base(url)
-	if filename == "." || filename == "/" {
-		filename = "file" + filepath.Ext(url)
-	}
 
-	return data, filename, nil
+	return config.AllowedExtensions[ext]
 }
 
 // decodeJSONBody decodes provided json body.